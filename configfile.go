@@ -27,18 +27,69 @@
 //
 // The order of processing follows standard flag package behavior, with
 // later files (and values) overriding earlier ones.
+//
+// Values may reference environment variables using "${VAR}" or "$VAR"
+// syntax; references are expanded before the value is passed to
+// flag.Set. This keeps secrets like API keys out of committed config
+// files:
+//
+//	db-password = ${DB_PASSWORD}
+//
+// A literal dollar sign can be written as "\$" or "$$".
+//
+// Current flag values can be written back out to a config file with Save
+// (or SaveChanged, which only writes flags that differ from their
+// defaults), producing a file that Load can read back in.
+//
+// Load always targets the global flag.CommandLine flag set. To load config
+// into a flag set of your own - useful for subcommands, or for tests that
+// shouldn't touch the global flags - use LoadFlagSet instead.
+//
+// The config file's extension selects how it's parsed: ".conf" and ".ini"
+// files (and files with no extension) use the "key = value" format
+// described above, and ".json" files are decoded as JSON, with nested
+// objects flattened into dotted flag names (e.g. {"server":{"port":9090}}
+// sets "server.port"). Additional formats - YAML, TOML, or anything else -
+// can be added with RegisterParser without configfile itself depending on
+// those formats' packages.
+//
+// The default format also supports "[section]" header lines, which
+// prepend "section." to the names of the keys that follow, and
+// LoadWithPrefix, which prepends a caller-supplied prefix to every key in
+// the file programmatically.
+//
+// It also supports composing config files out of smaller ones: an
+// "@include pattern" or "include = pattern" line loads another file (or,
+// via a glob, several files in lexical order) relative to the including
+// file's directory, e.g.:
+//
+//	@include conf.d/*.conf
+//
+// Included files can include further files; cycles are detected and
+// reported as an error.
+//
+// By default, an unknown flag name aborts loading immediately, just like
+// an invalid command-line flag would. A Loader (see NewLoader) can relax
+// this: Strict set to false collects every unknown-flag error instead and
+// returns them joined together once the file's been fully read;
+// AllowUnknown skips unknown flags entirely; and OnUnknown/OnDuplicate let
+// a caller implement its own policy instead (e.g. warn-only, for forward
+// compatibility across versions of a config file). ErrorHandling mirrors
+// flag.ErrorHandling, for callers that want Load to exit or panic rather
+// than return an error.
 package configfile
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
 
 // Load reads configuration values from the specified configuration file and
-// sets them using the flag package.
+// sets them on the global flag.CommandLine flag set. It's equivalent to
+// calling LoadFlagSet(flag.CommandLine, configfile).
 //
 // The configuration file should be in the format of "key=value" pairs, one per
 // line. The keys correspond directly to flag names defined in the program.
@@ -64,36 +115,116 @@ import (
 //
 // If the file cannot be opened or read, Load returns an error with details.
 func Load(configfile string) error {
-	file, err := os.Open(configfile)
+	return LoadFlagSet(flag.CommandLine, configfile)
+}
+
+// LoadFlagSet reads configuration values from the specified configuration
+// file and sets them on fs, using the same format and rules as Load.
+//
+// It's a convenience wrapper around NewLoader(fs).Load(configfile); use
+// NewLoader directly when you need to configure the Loader further.
+func LoadFlagSet(fs *flag.FlagSet, configfile string) error {
+	return NewLoader(fs).Load(configfile)
+}
+
+// LoadWithPrefix reads configuration values from the specified
+// configuration file and sets them on the global flag.CommandLine flag
+// set, prepending prefix (joined with ".") to every flag name.
+//
+// For example, LoadWithPrefix("db.conf", "db") reads a "host = localhost"
+// line as if it were "db.host = localhost". It's a convenience wrapper
+// around NewLoader(flag.CommandLine).LoadWithPrefix(configfile, prefix);
+// use NewLoader to choose a different separator.
+func LoadWithPrefix(configfile, prefix string) error {
+	return NewLoader(flag.CommandLine).LoadWithPrefix(configfile, prefix)
+}
+
+// Save writes the current values of all registered flags to the named file,
+// in the same "key = value" format that Load consumes. Each flag's Usage
+// string is written as a "# comment" above its entry.
+//
+// If the file cannot be created, Save returns an error with details.
+func Save(path string) error {
+	file, err := os.Create(path)
 	if err != nil {
-		return fmt.Errorf("failed to open file '%s': %w", configfile, err)
+		return fmt.Errorf("failed to create file '%s': %w", path, err)
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
+	if err := WriteTo(file); err != nil {
+		return fmt.Errorf("failed to write file '%s': %w", path, err)
+	}
 
-		name, value, found := strings.Cut(line, "=")
-		if !found {
-			return fmt.Errorf("failed to split line (expected to find an '='): %s", line)
-		}
+	return nil
+}
 
-		name = strings.TrimSpace(name)
-		value = strings.TrimSpace(value)
+// WriteTo writes the current values of all registered flags to w, in the
+// same format that Save writes to a file.
+func WriteTo(w io.Writer) error {
+	return writeFlags(w, flag.VisitAll)
+}
 
-		if err := flag.Set(name, value); err != nil {
-			return fmt.Errorf("failed to set flag '%s' to value '%s': %w", name, value, err)
-		}
+// SaveChanged writes the current values of only those flags that have been
+// explicitly set to a value other than their default to the named file. It's
+// useful for persisting runtime overrides without writing out every default.
+//
+// If the file cannot be created, SaveChanged returns an error with details.
+func SaveChanged(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create file '%s': %w", path, err)
 	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to scan: %w", err)
+	defer file.Close()
+
+	if err := WriteChangedTo(file); err != nil {
+		return fmt.Errorf("failed to write file '%s': %w", path, err)
 	}
 
 	return nil
 }
+
+// WriteChangedTo writes the current values of only those flags that have
+// been explicitly set to a value other than their default to w, in the same
+// format that SaveChanged writes to a file.
+func WriteChangedTo(w io.Writer) error {
+	return writeFlags(w, func(fn func(*flag.Flag)) {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Value.String() != f.DefValue {
+				fn(f)
+			}
+		})
+	})
+}
+
+// writeFlags writes "key = value" lines for each flag visited by visit,
+// preceded by a "# comment" line when the flag has a Usage string.
+func writeFlags(w io.Writer, visit func(func(*flag.Flag))) error {
+	var err error
+
+	visit(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		if f.Usage != "" {
+			if _, werr := fmt.Fprintf(w, "# %s\n", f.Usage); werr != nil {
+				err = werr
+				return
+			}
+		}
+		if _, werr := fmt.Fprintf(w, "%s = %s\n\n", f.Name, escapeValue(f.Value.String())); werr != nil {
+			err = werr
+			return
+		}
+	})
+
+	return err
+}
+
+// escapeValue doubles up any literal '$' in value, so that writing it out
+// and reading it back in with expandEnv round-trips exactly, rather than
+// expandEnv mistaking it for the start of an environment variable
+// reference. The one exception is a backslash directly before a '$':
+// expandEnv reads "\$" as an escape, so such a value does not round-trip.
+func escapeValue(value string) string {
+	return strings.ReplaceAll(value, "$", "$$")
+}
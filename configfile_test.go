@@ -1,9 +1,13 @@
 package configfile_test
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/michaellenaghan/go-configfile"
@@ -204,6 +208,80 @@ func TestLoad(t *testing.T) {
 		}
 	})
 
+	t.Run("Environment variable expansion", func(t *testing.T) {
+		os.Setenv("CONFIGFILE_TEST_HOST", "db.example.com")
+		defer os.Unsetenv("CONFIGFILE_TEST_HOST")
+
+		tmpfile, err := os.CreateTemp("", "config_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tmpfile.Name())
+
+		content := "key1 = ${CONFIGFILE_TEST_HOST}:5432\nkey2 = $CONFIGFILE_TEST_HOST\n"
+		if _, err := tmpfile.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tmpfile.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := configfile.Load(tmpfile.Name()); err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+
+		if v := flag.Lookup("key1").Value.String(); v != "db.example.com:5432" {
+			t.Errorf("Expected key1 to be db.example.com:5432, got %s", v)
+		}
+		if v := flag.Lookup("key2").Value.String(); v != "db.example.com" {
+			t.Errorf("Expected key2 to be db.example.com, got %s", v)
+		}
+	})
+
+	t.Run("Environment variable escaping", func(t *testing.T) {
+		tmpfile, err := os.CreateTemp("", "config_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tmpfile.Name())
+
+		content := `key1 = \$5.00`
+		if _, err := tmpfile.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tmpfile.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := configfile.Load(tmpfile.Name()); err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+
+		if v := flag.Lookup("key1").Value.String(); v != "$5.00" {
+			t.Errorf("Expected key1 to be $5.00, got %s", v)
+		}
+	})
+
+	t.Run("Malformed environment variable reference", func(t *testing.T) {
+		tmpfile, err := os.CreateTemp("", "config_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tmpfile.Name())
+
+		content := "key1 = ${UNCLOSED"
+		if _, err := tmpfile.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tmpfile.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := configfile.Load(tmpfile.Name()); err == nil {
+			t.Error("Load() expected error for malformed environment variable reference, got nil")
+		}
+	})
+
 	t.Run("Non-existent file", func(t *testing.T) {
 		if err := configfile.Load("Non-existent file"); err == nil {
 			t.Errorf("Load() error = %v, wantErr <not-nil>", err)
@@ -244,3 +322,555 @@ func TestLoad(t *testing.T) {
 		})
 	}
 }
+
+func TestSave(t *testing.T) {
+	fs := flag.NewFlagSet("TestSave", flag.ContinueOnError)
+	host := fs.String("host", "localhost", "Server host")
+	fs.Int("port", 8080, "Server port")
+	fs.Set("host", "example.com")
+
+	oldCommandLine := flag.CommandLine
+	flag.CommandLine = fs
+	defer func() { flag.CommandLine = oldCommandLine }()
+
+	t.Run("WriteTo", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := configfile.WriteTo(&buf); err != nil {
+			t.Fatalf("WriteTo() unexpected error: %v", err)
+		}
+
+		out := buf.String()
+		if !strings.Contains(out, "# Server host\nhost = example.com\n") {
+			t.Errorf("WriteTo() output missing host entry, got:\n%s", out)
+		}
+		if !strings.Contains(out, "# Server port\nport = 8080\n") {
+			t.Errorf("WriteTo() output missing port entry, got:\n%s", out)
+		}
+	})
+
+	t.Run("WriteChangedTo", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := configfile.WriteChangedTo(&buf); err != nil {
+			t.Fatalf("WriteChangedTo() unexpected error: %v", err)
+		}
+
+		out := buf.String()
+		if !strings.Contains(out, "host = example.com") {
+			t.Errorf("WriteChangedTo() output missing changed host entry, got:\n%s", out)
+		}
+		if strings.Contains(out, "port =") {
+			t.Errorf("WriteChangedTo() output unexpectedly includes unchanged port entry, got:\n%s", out)
+		}
+	})
+
+	t.Run("Save and reload", func(t *testing.T) {
+		tmpfile, err := os.CreateTemp("", "config_save")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tmpfile.Name())
+
+		if err := configfile.Save(tmpfile.Name()); err != nil {
+			t.Fatalf("Save() unexpected error: %v", err)
+		}
+
+		*host = "overwritten"
+
+		if err := configfile.Load(tmpfile.Name()); err != nil {
+			t.Fatalf("Load() unexpected error reloading saved file: %v", err)
+		}
+		if *host != "example.com" {
+			t.Errorf("Expected host to be restored to example.com, got %s", *host)
+		}
+	})
+
+	t.Run("Save and reload escapes literal dollar signs", func(t *testing.T) {
+		*host = `$5.00literal`
+
+		tmpfile, err := os.CreateTemp("", "config_save")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tmpfile.Name())
+
+		if err := configfile.Save(tmpfile.Name()); err != nil {
+			t.Fatalf("Save() unexpected error: %v", err)
+		}
+
+		*host = "overwritten"
+
+		if err := configfile.Load(tmpfile.Name()); err != nil {
+			t.Fatalf("Load() unexpected error reloading saved file: %v", err)
+		}
+		if *host != `$5.00literal` {
+			t.Errorf("Expected host to round-trip as $5.00literal, got %s", *host)
+		}
+	})
+}
+
+func TestLoadFlagSet(t *testing.T) {
+	fs := flag.NewFlagSet("TestLoadFlagSet", flag.ContinueOnError)
+	host := fs.String("host", "localhost", "Server host")
+	port := fs.Int("port", 8080, "Server port")
+
+	tmpfile, err := os.CreateTemp("", "config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	content := "host = example.com\nport = 9090\n"
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configfile.LoadFlagSet(fs, tmpfile.Name()); err != nil {
+		t.Fatalf("LoadFlagSet() unexpected error: %v", err)
+	}
+
+	if *host != "example.com" {
+		t.Errorf("Expected host to be example.com, got %s", *host)
+	}
+	if *port != 9090 {
+		t.Errorf("Expected port to be 9090, got %d", *port)
+	}
+
+	if flag.Lookup("host") != nil {
+		t.Error("LoadFlagSet() unexpectedly set a flag on the global flag.CommandLine")
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	fs := flag.NewFlagSet("TestLoadJSON", flag.ContinueOnError)
+	host := fs.String("host", "localhost", "Server host")
+	port := fs.Int("server.port", 8080, "Server port")
+
+	tmpfile, err := os.CreateTemp("", "config_test*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	content := `{"host": "example.com", "server": {"port": 9090}}`
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configfile.LoadFlagSet(fs, tmpfile.Name()); err != nil {
+		t.Fatalf("LoadFlagSet() unexpected error: %v", err)
+	}
+
+	if *host != "example.com" {
+		t.Errorf("Expected host to be example.com, got %s", *host)
+	}
+	if *port != 9090 {
+		t.Errorf("Expected server.port to be 9090, got %d", *port)
+	}
+}
+
+func TestLoadJSONLargeNumbers(t *testing.T) {
+	fs := flag.NewFlagSet("TestLoadJSONLargeNumbers", flag.ContinueOnError)
+	maxFileSize := fs.Int64("max-file-size", 0, "Maximum file size")
+
+	tmpfile, err := os.CreateTemp("", "config_test*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	content := `{"max-file-size": 104857600}`
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configfile.LoadFlagSet(fs, tmpfile.Name()); err != nil {
+		t.Fatalf("LoadFlagSet() unexpected error: %v", err)
+	}
+
+	if *maxFileSize != 104857600 {
+		t.Errorf("Expected max-file-size to be 104857600, got %d", *maxFileSize)
+	}
+}
+
+func TestRegisterParser(t *testing.T) {
+	configfile.RegisterParser("csv", func(r io.Reader, set func(name, value string) error) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		name, value, _ := strings.Cut(strings.TrimSpace(string(data)), ",")
+		return set(name, value)
+	})
+
+	fs := flag.NewFlagSet("TestRegisterParser", flag.ContinueOnError)
+	host := fs.String("host", "localhost", "Server host")
+
+	tmpfile, err := os.CreateTemp("", "config_test*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte("host,example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configfile.LoadFlagSet(fs, tmpfile.Name()); err != nil {
+		t.Fatalf("LoadFlagSet() unexpected error: %v", err)
+	}
+
+	if *host != "example.com" {
+		t.Errorf("Expected host to be example.com, got %s", *host)
+	}
+}
+
+func TestLoadSections(t *testing.T) {
+	fs := flag.NewFlagSet("TestLoadSections", flag.ContinueOnError)
+	port := fs.Int("server.port", 8080, "Server port")
+	host := fs.String("server.host", "localhost", "Server host")
+	name := fs.String("name", "myapp", "Application name")
+
+	tmpfile, err := os.CreateTemp("", "config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	content := "name = myapp2\n\n[server]\nport = 9090\nhost = example.com\n"
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := configfile.LoadFlagSet(fs, tmpfile.Name()); err != nil {
+		t.Fatalf("LoadFlagSet() unexpected error: %v", err)
+	}
+
+	if *name != "myapp2" {
+		t.Errorf("Expected name to be myapp2, got %s", *name)
+	}
+	if *port != 9090 {
+		t.Errorf("Expected server.port to be 9090, got %d", *port)
+	}
+	if *host != "example.com" {
+		t.Errorf("Expected server.host to be example.com, got %s", *host)
+	}
+}
+
+func TestLoadSectionsWithSeparator(t *testing.T) {
+	fs := flag.NewFlagSet("TestLoadSectionsWithSeparator", flag.ContinueOnError)
+	port := fs.Int("server-port", 8080, "Server port")
+
+	tmpfile, err := os.CreateTemp("", "config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	content := "[server]\nport = 9090\n"
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := configfile.NewLoader(fs)
+	loader.Separator = "-"
+	if err := loader.Load(tmpfile.Name()); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+
+	if *port != 9090 {
+		t.Errorf("Expected server-port to be 9090, got %d", *port)
+	}
+}
+
+func TestLoadWithPrefix(t *testing.T) {
+	fs := flag.NewFlagSet("TestLoadWithPrefix", flag.ContinueOnError)
+	port := fs.Int("db.port", 5432, "Database port")
+
+	tmpfile, err := os.CreateTemp("", "config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write([]byte("port = 5433")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := configfile.NewLoader(fs)
+	if err := loader.LoadWithPrefix(tmpfile.Name(), "db"); err != nil {
+		t.Fatalf("LoadWithPrefix() unexpected error: %v", err)
+	}
+
+	if *port != 5433 {
+		t.Errorf("Expected db.port to be 5433, got %d", *port)
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "config_includes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	confD := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(confD, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(confD, "a.conf"), []byte("host = a.example.com"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(confD, "b.conf"), []byte("port = 9090"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	global := filepath.Join(dir, "global.conf")
+	if err := os.WriteFile(global, []byte("@include conf.d/*.conf\nname = myapp"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("TestLoadIncludes", flag.ContinueOnError)
+	host := fs.String("host", "localhost", "Server host")
+	port := fs.Int("port", 8080, "Server port")
+	name := fs.String("name", "", "Application name")
+
+	if err := configfile.LoadFlagSet(fs, global); err != nil {
+		t.Fatalf("LoadFlagSet() unexpected error: %v", err)
+	}
+
+	if *host != "a.example.com" {
+		t.Errorf("Expected host to be a.example.com, got %s", *host)
+	}
+	if *port != 9090 {
+		t.Errorf("Expected port to be 9090, got %d", *port)
+	}
+	if *name != "myapp" {
+		t.Errorf("Expected name to be myapp, got %s", *name)
+	}
+
+	t.Run("include directive", func(t *testing.T) {
+		other := filepath.Join(dir, "other.conf")
+		if err := os.WriteFile(other, []byte("include = conf.d/a.conf"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		fs := flag.NewFlagSet("TestLoadIncludes/include", flag.ContinueOnError)
+		host := fs.String("host", "localhost", "Server host")
+
+		if err := configfile.LoadFlagSet(fs, other); err != nil {
+			t.Fatalf("LoadFlagSet() unexpected error: %v", err)
+		}
+		if *host != "a.example.com" {
+			t.Errorf("Expected host to be a.example.com, got %s", *host)
+		}
+	})
+
+	t.Run("include directive yields to a real 'include' flag", func(t *testing.T) {
+		other := filepath.Join(dir, "realflag.conf")
+		if err := os.WriteFile(other, []byte("include = conf.d/a.conf"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		fs := flag.NewFlagSet("TestLoadIncludes/realflag", flag.ContinueOnError)
+		include := fs.String("include", "", "Files to include")
+
+		if err := configfile.LoadFlagSet(fs, other); err != nil {
+			t.Fatalf("LoadFlagSet() unexpected error: %v", err)
+		}
+		if *include != "conf.d/a.conf" {
+			t.Errorf("Expected include to be conf.d/a.conf, got %s", *include)
+		}
+	})
+
+	t.Run("cycle detection", func(t *testing.T) {
+		selfRef := filepath.Join(dir, "selfref.conf")
+		if err := os.WriteFile(selfRef, []byte("@include selfref.conf"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		fs := flag.NewFlagSet("TestLoadIncludes/cycle", flag.ContinueOnError)
+
+		if err := configfile.LoadFlagSet(fs, selfRef); err == nil {
+			t.Error("LoadFlagSet() expected error for include cycle, got nil")
+		}
+	})
+
+	t.Run("no matching files", func(t *testing.T) {
+		noMatch := filepath.Join(dir, "nomatch.conf")
+		if err := os.WriteFile(noMatch, []byte("@include conf.d/*.yaml"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		fs := flag.NewFlagSet("TestLoadIncludes/nomatch", flag.ContinueOnError)
+
+		if err := configfile.LoadFlagSet(fs, noMatch); err == nil {
+			t.Error("LoadFlagSet() expected error for include pattern matching no files, got nil")
+		}
+	})
+}
+
+func TestLoaderErrorHandling(t *testing.T) {
+	writeTemp := func(t *testing.T, content string) string {
+		t.Helper()
+		tmpfile, err := os.CreateTemp("", "config_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Remove(tmpfile.Name()) })
+		if _, err := tmpfile.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tmpfile.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return tmpfile.Name()
+	}
+
+	t.Run("Strict aborts on first unknown flag", func(t *testing.T) {
+		fs := flag.NewFlagSet("TestLoaderErrorHandling/strict", flag.ContinueOnError)
+		key1 := fs.String("key1", "", "key1 flag")
+
+		path := writeTemp(t, "unknown1 = value\nkey1 = value1\nunknown2 = value")
+
+		loader := configfile.NewLoader(fs)
+		if err := loader.Load(path); err == nil {
+			t.Error("Load() expected error for unknown flag, got nil")
+		}
+		if *key1 != "" {
+			t.Errorf("Expected key1 to remain unset after aborting, got %s", *key1)
+		}
+	})
+
+	t.Run("Non-strict collects unknown flags and keeps going", func(t *testing.T) {
+		fs := flag.NewFlagSet("TestLoaderErrorHandling/nonstrict", flag.ContinueOnError)
+		key1 := fs.String("key1", "", "key1 flag")
+
+		path := writeTemp(t, "unknown1 = value\nkey1 = value1\nunknown2 = value")
+
+		loader := configfile.NewLoader(fs)
+		loader.Strict = false
+		err := loader.Load(path)
+		if err == nil {
+			t.Fatal("Load() expected joined error for unknown flags, got nil")
+		}
+		if !strings.Contains(err.Error(), "unknown1") || !strings.Contains(err.Error(), "unknown2") {
+			t.Errorf("Expected error to mention both unknown flags, got: %v", err)
+		}
+		if *key1 != "value1" {
+			t.Errorf("Expected key1 to be set despite unknown flags, got %s", *key1)
+		}
+	})
+
+	t.Run("AllowUnknown skips unknown flags", func(t *testing.T) {
+		fs := flag.NewFlagSet("TestLoaderErrorHandling/allowunknown", flag.ContinueOnError)
+		key1 := fs.String("key1", "", "key1 flag")
+
+		path := writeTemp(t, "unknown1 = value\nkey1 = value1")
+
+		loader := configfile.NewLoader(fs)
+		loader.AllowUnknown = true
+		if err := loader.Load(path); err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+		if *key1 != "value1" {
+			t.Errorf("Expected key1 to be set, got %s", *key1)
+		}
+	})
+
+	t.Run("OnUnknown overrides default handling", func(t *testing.T) {
+		fs := flag.NewFlagSet("TestLoaderErrorHandling/onunknown", flag.ContinueOnError)
+
+		path := writeTemp(t, "unknown1 = value")
+
+		var seen []string
+		loader := configfile.NewLoader(fs)
+		loader.OnUnknown = func(name, value string) error {
+			seen = append(seen, name)
+			return nil
+		}
+		if err := loader.Load(path); err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+		if len(seen) != 1 || seen[0] != "unknown1" {
+			t.Errorf("Expected OnUnknown to be called with 'unknown1', got %v", seen)
+		}
+	})
+
+	t.Run("OnDuplicate is called for repeated flags", func(t *testing.T) {
+		fs := flag.NewFlagSet("TestLoaderErrorHandling/onduplicate", flag.ContinueOnError)
+		fs.String("key1", "", "key1 flag")
+
+		path := writeTemp(t, "key1 = value1\nkey1 = value2")
+
+		var calls int
+		loader := configfile.NewLoader(fs)
+		loader.OnDuplicate = func(name, value string) error {
+			calls++
+			return nil
+		}
+		if err := loader.Load(path); err != nil {
+			t.Fatalf("Load() unexpected error: %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("Expected OnDuplicate to be called once, got %d", calls)
+		}
+	})
+
+	t.Run("OnDuplicate error aborts the load", func(t *testing.T) {
+		fs := flag.NewFlagSet("TestLoaderErrorHandling/onduplicateerr", flag.ContinueOnError)
+		fs.String("key1", "", "key1 flag")
+
+		path := writeTemp(t, "key1 = value1\nkey1 = value2")
+
+		loader := configfile.NewLoader(fs)
+		loader.OnDuplicate = func(name, value string) error {
+			return fmt.Errorf("duplicate flag '%s'", name)
+		}
+		if err := loader.Load(path); err == nil {
+			t.Error("Load() expected error from OnDuplicate, got nil")
+		}
+	})
+
+	t.Run("PanicOnError panics with the error", func(t *testing.T) {
+		fs := flag.NewFlagSet("TestLoaderErrorHandling/panic", flag.ContinueOnError)
+
+		path := writeTemp(t, "unknown1 = value")
+
+		loader := configfile.NewLoader(fs)
+		loader.ErrorHandling = flag.PanicOnError
+
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatal("Load() expected a panic, got none")
+			}
+			if err, ok := r.(error); !ok || !strings.Contains(err.Error(), "unknown1") {
+				t.Errorf("Expected panic value to be an error mentioning 'unknown1', got %v", r)
+			}
+		}()
+
+		_ = loader.Load(path)
+	})
+}
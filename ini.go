@@ -0,0 +1,145 @@
+package configfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadCtx tracks which config files are already being loaded, so that
+// loadINIFile can detect "@include" cycles across the whole recursive
+// load, not just within a single file.
+type loadCtx struct {
+	visiting map[string]struct{}
+}
+
+func newLoadCtx() *loadCtx {
+	return &loadCtx{visiting: make(map[string]struct{})}
+}
+
+// loadINIFile is the default Parser for ".conf" and ".ini" files, and the
+// fallback for files with no extension or no registered Parser. Unlike a
+// plain Parser, it's given the file's path (rather than an already-open
+// io.Reader) so that it can resolve "@include" directives relative to the
+// including file's directory and recurse into them.
+//
+// It implements the "key = value" format documented on Load, plus two
+// extensions:
+//
+//   - A "[section]" header line groups the key/value pairs that follow
+//     it, prepending "section" and sep to each of their names until the
+//     next header (or the end of the file). For example, with sep ".":
+//
+//     [server]
+//     port = 9090
+//
+//     sets the "server.port" flag, equivalent to "server.port = 9090".
+//
+//   - An "@include pattern" or "include = pattern" line loads another
+//     file (or, via a glob, several files in lexical order) relative to
+//     the including file's directory before continuing. Included files
+//     can themselves include further files; a cycle (a file including
+//     itself, directly or transitively) is reported as an error. The
+//     bare "include = pattern" form only triggers when isKnown reports
+//     that there's no actual flag by that name, so a program that defines
+//     its own "include" (or, inside a "[section]", a flag that resolves
+//     to "section.include") can still set it; "@include" always does.
+func loadINIFile(path, sep string, ctx *loadCtx, isKnown func(name string) bool, set func(name, value string) error) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path '%s': %w", path, err)
+	}
+	if _, ok := ctx.visiting[abs]; ok {
+		return fmt.Errorf("include cycle detected: '%s' is already being loaded", path)
+	}
+	ctx.visiting[abs] = struct{}{}
+	defer delete(ctx.visiting, abs)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	dir := filepath.Dir(path)
+	section := ""
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if pattern, ok := strings.CutPrefix(line, "@include "); ok {
+			if err := loadIncludes(dir, strings.TrimSpace(pattern), sep, ctx, isKnown, set); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			return fmt.Errorf("failed to split line (expected to find an '='): %s", line)
+		}
+
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+
+		resolved := name
+		if section != "" {
+			resolved = section + sep + name
+		}
+
+		if name == "include" && !isKnown(resolved) {
+			if err := loadIncludes(dir, value, sep, ctx, isKnown, set); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := set(resolved, value); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to scan: %w", err)
+	}
+
+	return nil
+}
+
+// loadIncludes resolves pattern relative to dir (unless it's already
+// absolute), expands it as a glob, and loads each matching file in
+// lexical order (the order filepath.Glob already returns matches in).
+func loadIncludes(dir, pattern, sep string, ctx *loadCtx, isKnown func(name string) bool, set func(name, value string) error) error {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("failed to expand include pattern '%s': %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("include pattern '%s' matched no files", pattern)
+	}
+
+	for _, match := range matches {
+		if err := loadINIFile(match, sep, ctx, isKnown, set); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
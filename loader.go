@@ -0,0 +1,249 @@
+package configfile
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Loader loads configuration values from a file into a specific flag set.
+// The zero value is not usable; construct one with NewLoader.
+type Loader struct {
+	// FlagSet is the flag set that configuration values are applied to.
+	FlagSet *flag.FlagSet
+
+	// Separator joins name components into a flag name: a LoadWithPrefix
+	// prefix with the rest of the name, and (in the default "key = value"
+	// format) a "[section]" header with the names of the keys inside it.
+	// It defaults to "." when empty.
+	Separator string
+
+	// ErrorHandling mirrors flag.ErrorHandling: it controls what Load does
+	// once it has an error to report. flag.ContinueOnError (the zero
+	// value) returns the error to the caller; flag.ExitOnError prints it
+	// and calls os.Exit(2); flag.PanicOnError panics with it.
+	ErrorHandling flag.ErrorHandling
+
+	// Strict controls how an unknown flag name - one with no
+	// corresponding flag in FlagSet - is handled. When true (the default
+	// set by NewLoader), Load aborts as soon as it encounters one. When
+	// false, Load keeps reading the rest of the file and returns every
+	// unknown-flag error it collected, joined together, once it's done.
+	//
+	// Strict has no effect on other errors (a malformed line, or a value
+	// that's invalid for a flag's type); those always abort immediately.
+	Strict bool
+
+	// AllowUnknown, when true, skips unknown flag names - logging each
+	// one - instead of treating them as an error. It's overridden by
+	// OnUnknown, if that's also set.
+	AllowUnknown bool
+
+	// OnUnknown, if non-nil, is called in place of the default handling
+	// for each unknown flag name. Returning a non-nil error reports it,
+	// subject to Strict; returning nil treats the flag as handled.
+	OnUnknown func(name, value string) error
+
+	// OnDuplicate, if non-nil, is called whenever a flag name is set more
+	// than once while loading a single file (including across files
+	// pulled in with "@include"). Returning a non-nil error aborts the
+	// load immediately. The default is to allow it, matching the flag
+	// package's own "last one wins" behavior for repeated flags.
+	OnDuplicate func(name, value string) error
+}
+
+// NewLoader returns a Loader that applies configuration values to fs, with
+// Strict set to true.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	return &Loader{FlagSet: fs, Strict: true}
+}
+
+// Load reads configuration values from the specified configuration file and
+// sets them on l.FlagSet. See Load (the package-level function) for the
+// file format and error conditions; LoadFlagSet(fs, configfile) is
+// equivalent to NewLoader(fs).Load(configfile).
+//
+// The file's contents are parsed according to its extension: a Parser
+// registered for that extension (the built-in JSON parser for ".json", or
+// one added via RegisterParser) is used if one exists, and the default
+// "key = value" parser is used otherwise. See
+// RegisterParser for details.
+func (l *Loader) Load(configfile string) error {
+	return l.load(configfile, "")
+}
+
+// LoadWithPrefix reads configuration values the same way Load does, but
+// prepends prefix (joined with l.Separator) to every flag name before
+// setting it. It's the programmatic equivalent of wrapping the whole file
+// in a "[prefix]" section; see loadINIFile.
+func (l *Loader) LoadWithPrefix(configfile, prefix string) error {
+	return l.load(configfile, prefix)
+}
+
+func (l *Loader) load(configfile, prefix string) error {
+	sep := l.Separator
+	if sep == "" {
+		sep = "."
+	}
+
+	seen := make(map[string]bool)
+	var unknown []error
+
+	set := func(name, value string) error {
+		if prefix != "" {
+			name = prefix + sep + name
+		}
+
+		if l.FlagSet.Lookup(name) == nil {
+			var err error
+			switch {
+			case l.OnUnknown != nil:
+				err = l.OnUnknown(name, value)
+			case l.AllowUnknown:
+				log.Printf("configfile: skipping unknown flag '%s'", name)
+				return nil
+			default:
+				err = fmt.Errorf("unknown flag '%s'", name)
+			}
+			if err == nil {
+				return nil
+			}
+			if l.Strict {
+				return err
+			}
+			unknown = append(unknown, err)
+			return nil
+		}
+
+		if seen[name] && l.OnDuplicate != nil {
+			if err := l.OnDuplicate(name, value); err != nil {
+				return err
+			}
+		}
+		seen[name] = true
+
+		value, err := expandEnv(value)
+		if err != nil {
+			return fmt.Errorf("failed to expand value for flag '%s': %w", name, err)
+		}
+
+		if err := l.FlagSet.Set(name, value); err != nil {
+			return fmt.Errorf("failed to set flag '%s' to value '%s': %w", name, value, err)
+		}
+
+		return nil
+	}
+
+	var err error
+	if p := parserFor(filepath.Ext(configfile)); p != nil {
+		var file *os.File
+		file, err = os.Open(configfile)
+		if err != nil {
+			err = fmt.Errorf("failed to open file '%s': %w", configfile, err)
+		} else {
+			defer file.Close()
+			err = p(file, set)
+		}
+	} else {
+		isKnown := func(name string) bool {
+			if prefix != "" {
+				name = prefix + sep + name
+			}
+			return l.FlagSet.Lookup(name) != nil
+		}
+		err = loadINIFile(configfile, sep, newLoadCtx(), isKnown, set)
+	}
+
+	if err == nil {
+		err = errors.Join(unknown...)
+	}
+
+	return l.report(err)
+}
+
+// report applies l.ErrorHandling to a non-nil err, or returns nil
+// unchanged.
+func (l *Loader) report(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch l.ErrorHandling {
+	case flag.ExitOnError:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	case flag.PanicOnError:
+		panic(err)
+	}
+
+	return err
+}
+
+// expandEnv expands "${VAR}" and "$VAR" environment variable references in
+// s. Both "\$" and "$$" produce a literal dollar sign (unlike the shell,
+// where "$$" is the process ID). It returns an error if a "${...}" reference is
+// malformed (unterminated or empty).
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if c == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+
+		if c != '$' {
+			b.WriteByte(c)
+			continue
+		}
+
+		if i+1 < len(s) && s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+
+		if i+1 < len(s) && s[i+1] == '{' {
+			end := strings.IndexByte(s[i+2:], '}')
+			if end == -1 {
+				return "", fmt.Errorf("malformed reference %q: missing closing '}'", s[i:])
+			}
+			name := s[i+2 : i+2+end]
+			if name == "" {
+				return "", fmt.Errorf("malformed reference %q: empty variable name", s[i:i+3+end])
+			}
+			b.WriteString(os.Getenv(name))
+			i += 2 + end
+			continue
+		}
+
+		j := i + 1
+		for j < len(s) && isEnvNameByte(s[j]) {
+			j++
+		}
+		if j == i+1 {
+			b.WriteByte('$')
+			continue
+		}
+		b.WriteString(os.Getenv(s[i+1 : j]))
+		i = j - 1
+	}
+
+	return b.String(), nil
+}
+
+// isEnvNameByte reports whether b can appear in an unbraced "$VAR"
+// environment variable name.
+func isEnvNameByte(b byte) bool {
+	return b == '_' ||
+		(b >= 'a' && b <= 'z') ||
+		(b >= 'A' && b <= 'Z') ||
+		(b >= '0' && b <= '9')
+}
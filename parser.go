@@ -0,0 +1,113 @@
+package configfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Parser decodes configuration data read from r and calls set for each
+// name/value pair it finds. It should return an error from set unchanged,
+// and wrap any other error (e.g. a decoding failure) with context.
+type Parser func(r io.Reader, set func(name, value string) error) error
+
+// parsers maps a lowercased file extension (including the leading '.') to
+// the Parser used to decode files with that extension.
+//
+// ".conf", ".ini" and unrecognized extensions aren't registered here: the
+// Loader falls back to loadINIFile for them directly, so
+// that it can support "@include" directives. Registering a Parser for
+// ".conf" or ".ini" with RegisterParser overrides that default and
+// disables include support for those files.
+var parsers = map[string]Parser{
+	".json": parseJSON,
+}
+
+// RegisterParser registers p as the Parser for files whose extension is
+// ext (with or without a leading '.'; matching is case-insensitive),
+// replacing any parser previously registered for that extension.
+//
+// This lets callers add support for additional formats - YAML, TOML, or
+// anything else - without the configfile package importing those
+// dependencies itself:
+//
+//	configfile.RegisterParser(".yaml", func(r io.Reader, set func(name, value string) error) error {
+//		var data map[string]any
+//		if err := yaml.NewDecoder(r).Decode(&data); err != nil {
+//			return err
+//		}
+//		// flatten data and call set(name, value) for each entry
+//		return nil
+//	})
+func RegisterParser(ext string, p Parser) {
+	parsers[normalizeExt(ext)] = p
+}
+
+// parserFor returns the Parser registered for ext, or nil if none is
+// registered.
+func parserFor(ext string) Parser {
+	return parsers[normalizeExt(ext)]
+}
+
+// normalizeExt lowercases ext and ensures it has a leading '.', so that
+// RegisterParser("yaml", ...) and RegisterParser(".yaml", ...) are
+// equivalent.
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// parseJSON is the built-in Parser for ".json" files. Nested objects are
+// flattened into dotted flag names, so:
+//
+//	{"server": {"port": 9090}}
+//
+// sets the "server.port" flag, equivalent to "server.port = 9090" in the
+// default format.
+func parseJSON(r io.Reader, set func(name, value string) error) error {
+	var data map[string]any
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return fmt.Errorf("failed to decode JSON: %w", err)
+	}
+
+	return flattenJSON("", data, set)
+}
+
+// flattenJSON walks value, calling set(name, value) for every leaf it
+// finds, joining nested object keys onto prefix with '.'.
+func flattenJSON(prefix string, value any, set func(name, value string) error) error {
+	nested, ok := value.(map[string]any)
+	if !ok {
+		return set(prefix, formatJSONLeaf(value))
+	}
+
+	for key, v := range nested {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		if err := flattenJSON(name, v, set); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatJSONLeaf renders a decoded JSON leaf value as a flag value.
+// Numbers need special handling: encoding/json decodes them all as
+// float64, and fmt.Sprint switches to scientific notation (e.g.
+// "1.048576e+08") once they get large enough to break flag.Set on an
+// int/int64 flag, so they're formatted without an exponent instead,
+// dropping the decimal point when the value is a whole number.
+func formatJSONLeaf(value any) string {
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}